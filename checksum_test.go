@@ -0,0 +1,59 @@
+package getter
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumFromURL(t *testing.T) {
+	cases := []struct {
+		raw          string
+		wantAlgo     string
+		wantExpected string
+		wantOK       bool
+	}{
+		{"", "", "", false},
+		{"deadbeef", "md5", "deadbeef", true},
+		{"sha256:DEADBEEF", "sha256", "deadbeef", true},
+	}
+
+	for _, c := range cases {
+		u, err := url.Parse("https://example.com/x?checksum=" + c.raw)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		algo, expected, ok := checksumFromURL(u)
+		if ok != c.wantOK || algo != c.wantAlgo || expected != c.wantExpected {
+			t.Fatalf("checksumFromURL(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.raw, algo, expected, ok, c.wantAlgo, c.wantExpected, c.wantOK)
+		}
+	}
+}
+
+func TestVerifyFileChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// md5("hello world")
+	const wantMD5 = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+
+	if err := verifyFileChecksum(path, "md5", wantMD5); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := verifyFileChecksum(path, "md5", "0000000000000000000000000000000"); err == nil {
+		t.Fatal("expected error, got none")
+	} else if _, ok := err.(*ChecksumError); !ok {
+		t.Fatalf("expected *ChecksumError, got %T: %s", err, err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected file to be removed after checksum mismatch")
+	}
+}
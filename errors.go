@@ -0,0 +1,33 @@
+package getter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned (wrapped in a *NotFoundError) by a Getter when
+// the requested source does not exist, as opposed to e.g. an
+// authentication or network failure. Callers can check for it with
+// errors.Is(err, ErrNotFound) regardless of which Getter produced it.
+var ErrNotFound = errors.New("getter: source not found")
+
+// NotFoundError wraps the underlying transport error for a source that
+// could not be found, along with the URL that was requested.
+type NotFoundError struct {
+	URL string
+	Err error
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("getter: source not found: %s: %s", e.URL, e.Err)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrNotFound) succeed for any *NotFoundError,
+// independent of what the wrapped transport error happens to be.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
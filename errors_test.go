@@ -0,0 +1,21 @@
+package getter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNotFoundError_IsErrNotFound(t *testing.T) {
+	wrapped := errors.New("404 Blob Not Found")
+	err := &NotFoundError{URL: "https://example.blob.core.windows.net/c/b", Err: wrapped}
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected errors.Is(err, ErrNotFound) to be true")
+	}
+	if !errors.Is(err, wrapped) {
+		t.Fatal("expected errors.Is(err, wrapped) to be true")
+	}
+	if !errors.As(err, new(*NotFoundError)) {
+		t.Fatal("expected errors.As to find the *NotFoundError")
+	}
+}
@@ -0,0 +1,203 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// azureManagedIdentityProbeTimeout bounds how long a forced "?auth=msi"
+// waits for the instance metadata service to answer before concluding no
+// managed identity is available. NewManagedIdentityCredential itself never
+// contacts IMDS, so without this probe the forced mode would always report
+// success and defer the real failure to the first blob request.
+const azureManagedIdentityProbeTimeout = 2 * time.Second
+
+// azureStorageResourceScope is the OAuth scope requested when probing for a
+// usable Azure credential.
+const azureStorageResourceScope = "https://storage.azure.com/.default"
+
+// azureAuthMode forces a specific entry of the Azure credential resolution
+// chain instead of letting it probe for one, via the URL's "auth" query
+// parameter (e.g. "?auth=msi"). Shared by AzureBlobGetter and
+// AzureDataLakeGetter, since both authenticate against the same storage
+// account identity.
+type azureAuthMode string
+
+const (
+	azureAuthAuto           azureAuthMode = ""
+	azureAuthSAS            azureAuthMode = "sas"
+	azureAuthKey            azureAuthMode = "key"
+	azureAuthConnectionStr  azureAuthMode = "connstr"
+	azureAuthServicePrinc   azureAuthMode = "sp"
+	azureAuthManagedIdentiy azureAuthMode = "msi"
+)
+
+// azureResolvedAuth is the outcome of resolveAzureAuth: serviceURL is
+// always set, and exactly one of the remaining fields is populated, telling
+// the caller which kind of client constructor to use.
+type azureResolvedAuth struct {
+	// serviceURL is the account URL, including a SAS query string when
+	// sasQuery is set.
+	serviceURL string
+
+	sasQuery        bool
+	connectionStr   string
+	sharedKey       *azureSharedKey
+	tokenCredential azcore.TokenCredential
+}
+
+type azureSharedKey struct {
+	accountName string
+	accountKey  string
+}
+
+// resolveAzureAuth resolves credentials for the storage account referenced
+// by u, in the following order, mirroring the chain used by tools like
+// azcopy and rclone:
+//
+//  1. A SAS token already present in the URL's query string.
+//  2. explicit, if the caller set one (AzureBlobGetter.Credential /
+//     AzureDataLakeGetter.Credential).
+//  3. AZURE_STORAGE_CONNECTION_STRING.
+//  4. AZURE_STORAGE_ACCOUNT_KEY (paired with the account name from the host).
+//  5. AZURE_STORAGE_SAS_TOKEN.
+//  6. AZURE_CLIENT_ID / AZURE_TENANT_ID / AZURE_CLIENT_SECRET, for a service
+//     principal.
+//  7. ManagedIdentityCredential, falling back to DefaultAzureCredential, for
+//     workload identity (e.g. on AKS).
+//
+// The "auth" query parameter (?auth=msi, ?auth=sp, ?auth=key, ?auth=sas,
+// ?auth=connstr) forces a single entry of the chain and skips the rest.
+func resolveAzureAuth(u *url.URL, explicit azcore.TokenCredential) (*azureResolvedAuth, error) {
+	mode := azureAuthMode(u.Query().Get("auth"))
+	accountName := strings.SplitN(u.Host, ".", 2)[0]
+	serviceURL := fmt.Sprintf("https://%s/", u.Host)
+
+	if mode == azureAuthAuto || mode == azureAuthSAS {
+		if sas := sasTokenFromQuery(u); sas != "" {
+			return &azureResolvedAuth{serviceURL: serviceURL + "?" + sas, sasQuery: true}, nil
+		}
+		if mode == azureAuthSAS {
+			// Forced mode skips the rest of the chain anyway, so also check
+			// AZURE_STORAGE_SAS_TOKEN here rather than waiting for the auto
+			// chain's step 5 below, which a forced mode never reaches.
+			if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+				return &azureResolvedAuth{serviceURL: serviceURL + "?" + strings.TrimPrefix(sas, "?"), sasQuery: true}, nil
+			}
+			return nil, fmt.Errorf("getter: auth=sas requested but no SAS query parameters found in URL or AZURE_STORAGE_SAS_TOKEN")
+		}
+	}
+
+	if mode == azureAuthAuto && explicit != nil {
+		return &azureResolvedAuth{serviceURL: serviceURL, tokenCredential: explicit}, nil
+	}
+
+	if mode == azureAuthAuto || mode == azureAuthConnectionStr {
+		if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+			return &azureResolvedAuth{serviceURL: serviceURL, connectionStr: cs}, nil
+		}
+		if mode == azureAuthConnectionStr {
+			return nil, fmt.Errorf("getter: auth=connstr requested but AZURE_STORAGE_CONNECTION_STRING is not set")
+		}
+	}
+
+	if mode == azureAuthAuto || mode == azureAuthKey {
+		if key := os.Getenv("AZURE_STORAGE_ACCOUNT_KEY"); key != "" {
+			return &azureResolvedAuth{
+				serviceURL: serviceURL,
+				sharedKey:  &azureSharedKey{accountName: accountName, accountKey: key},
+			}, nil
+		}
+		if mode == azureAuthKey {
+			return nil, fmt.Errorf("getter: auth=key requested but AZURE_STORAGE_ACCOUNT_KEY is not set")
+		}
+	}
+
+	if mode == azureAuthAuto {
+		if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+			return &azureResolvedAuth{serviceURL: serviceURL + "?" + strings.TrimPrefix(sas, "?"), sasQuery: true}, nil
+		}
+	}
+
+	if mode == azureAuthAuto || mode == azureAuthServicePrinc {
+		clientID := os.Getenv("AZURE_CLIENT_ID")
+		tenantID := os.Getenv("AZURE_TENANT_ID")
+		clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+		if clientID != "" && tenantID != "" && clientSecret != "" {
+			cred, err := azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+			if err != nil {
+				return nil, fmt.Errorf("getter: building service principal credential: %w", err)
+			}
+			return &azureResolvedAuth{serviceURL: serviceURL, tokenCredential: cred}, nil
+		}
+		if mode == azureAuthServicePrinc {
+			return nil, fmt.Errorf("getter: auth=sp requested but AZURE_CLIENT_ID/AZURE_TENANT_ID/AZURE_CLIENT_SECRET are not all set")
+		}
+	}
+
+	if mode == azureAuthAuto || mode == azureAuthManagedIdentiy {
+		cred, err := azidentity.NewManagedIdentityCredential(nil)
+		if err == nil {
+			if mode == azureAuthManagedIdentiy {
+				// NewManagedIdentityCredential never contacts IMDS, so it
+				// can't tell us whether a managed identity is actually
+				// present; probe for one so we can give a clean error here
+				// instead of an opaque failure on the first blob request.
+				if !azureCredentialAvailable(cred) {
+					return nil, fmt.Errorf("getter: auth=msi requested but no managed identity is available")
+				}
+			}
+			return &azureResolvedAuth{serviceURL: serviceURL, tokenCredential: cred}, nil
+		}
+		if mode == azureAuthManagedIdentiy {
+			return nil, fmt.Errorf("getter: auth=msi requested but no managed identity is available")
+		}
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("getter: no Azure credential could be resolved for %s: %w", u.Host, err)
+	}
+	return &azureResolvedAuth{serviceURL: serviceURL, tokenCredential: cred}, nil
+}
+
+// azureCredentialAvailable probes cred with a short-timeout token request,
+// since azidentity's credential constructors don't themselves contact the
+// environment to confirm a credential is actually usable.
+func azureCredentialAvailable(cred azcore.TokenCredential) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), azureManagedIdentityProbeTimeout)
+	defer cancel()
+
+	_, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureStorageResourceScope}})
+	return err == nil
+}
+
+// sasTokenFromQuery returns the URL's raw query string if it looks like a
+// SAS token (i.e. it carries both the "sv" signed-version and the "sig"
+// signature parameters), or "" if not.
+func sasTokenFromQuery(u *url.URL) string {
+	q := u.Query()
+	if q.Get("sv") == "" || q.Get("sig") == "" {
+		return ""
+	}
+	return u.RawQuery
+}
+
+// containerAndBlob splits the URL path into the container (or filesystem)
+// name and the blob/file path (or prefix) within it.
+func containerAndBlob(u *url.URL) (string, string) {
+	path := strings.TrimPrefix(u.Path, "/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
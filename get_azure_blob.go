@@ -3,45 +3,202 @@ package getter
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	//
-	"github.com/Azure/azure-storage-blob-go/azblob"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 )
 
-// TODO: https://docs.microsoft.com/en-us/azure/storage/blobs/storage-quickstart-blobs-go?tabs=windows#understand-the-sample-code
+const (
+	// defaultAzureChunkSize is the size of each ranged GET issued while
+	// downloading a single blob, used when AzureBlobGetter.ChunkSize is 0.
+	defaultAzureChunkSize = 4 * 1024 * 1024 // 4 MiB
+
+	// defaultAzureParallelism is the number of concurrent chunk downloads
+	// (within a blob) or concurrent blob downloads (within a directory),
+	// used when AzureBlobGetter.Parallelism is 0.
+	defaultAzureParallelism = 4
+
+	// azureChunkMaxRetries is the number of attempts made to download a
+	// single chunk before giving up. Only the failed chunk is retried, not
+	// the whole blob.
+	azureChunkMaxRetries = 3
+)
+
+// ErrETagMismatch is returned when a source URL pins a blob to an "etag="
+// value that no longer matches the blob's current ETag, so the caller can
+// distinguish a drifted source from a missing one (a 404).
+var ErrETagMismatch = errors.New("getter: blob ETag does not match the URL's etag= parameter")
+
+// azureObjectSelector carries the optional "snapshot=", "versionid=",
+// "etag=" and "checksum=" query parameters used to pin a blob download to
+// an exact point in time and/or verify its integrity, mirroring what the
+// new azblob SDK and azcopy expose.
+type azureObjectSelector struct {
+	snapshot  string
+	versionID string
+	etag      string
+
+	checksumAlgo     string
+	checksumExpected string
+	hasChecksum      bool
+}
+
+func azureObjectSelectorFromURL(u *url.URL) azureObjectSelector {
+	q := u.Query()
+	algo, expected, ok := checksumFromURL(u)
+	return azureObjectSelector{
+		snapshot:         q.Get("snapshot"),
+		versionID:        q.Get("versionid"),
+		etag:             q.Get("etag"),
+		checksumAlgo:     algo,
+		checksumExpected: expected,
+		hasChecksum:      ok,
+	}
+}
+
+// pinned reports whether the selector pins the download to a specific
+// snapshot or version, which (like a single blob) can never be a
+// directory.
+func (s azureObjectSelector) pinned() bool {
+	return s.snapshot != "" || s.versionID != ""
+}
+
+// isAzurePreconditionFailed reports whether err is the SDK's
+// ConditionNotMet error, returned when an If-Match access condition (our
+// etag= pin) doesn't match the blob's current ETag.
+func isAzurePreconditionFailed(err error) bool {
+	return bloberror.HasCode(err, bloberror.ConditionNotMet)
+}
+
+// isAzureChunkRetryable reports whether a chunk download failure is worth
+// retrying. Precondition failures (the blob changed under us mid-download)
+// and authentication/authorization failures are permanent for the lifetime
+// of this download, so retrying them only wastes attempts and backoff time.
+func isAzureChunkRetryable(err error) bool {
+	if errors.Is(err, ErrETagMismatch) {
+		return false
+	}
+	if bloberror.HasCode(err,
+		bloberror.AuthenticationFailed,
+		bloberror.AuthorizationFailure,
+		bloberror.AuthorizationPermissionMismatch,
+		bloberror.AuthorizationProtocolMismatch,
+		bloberror.AuthorizationResourceTypeMismatch,
+		bloberror.AuthorizationServiceMismatch,
+		bloberror.AuthorizationSourceIPMismatch,
+		bloberror.InsufficientAccountPermissions,
+		bloberror.InvalidAuthenticationInfo,
+		bloberror.NoAuthenticationInformation,
+	) {
+		return false
+	}
+	return true
+}
 
 // AzureBlobGetter is a Getter implementation that will download a module from
 // an Azure Blob Storage Account.
 type AzureBlobGetter struct {
 	getter
+
+	// Credential, when set, is used verbatim to authenticate to the
+	// storage account instead of the environment-based entries of the
+	// resolution chain documented on resolveAzureAuth. A SAS token in the
+	// URL, or an "auth=" query parameter, takes precedence over it. Most
+	// callers should leave this nil.
+	Credential azcore.TokenCredential
+
+	// ChunkSize is the size, in bytes, of each ranged GET issued while
+	// downloading a single blob. Defaults to defaultAzureChunkSize.
+	ChunkSize int64
+
+	// Parallelism is the number of concurrent chunk downloads used per
+	// blob, and the number of concurrent blob downloads used per
+	// directory. Defaults to defaultAzureParallelism.
+	Parallelism int
+}
+
+func (g *AzureBlobGetter) chunkSize() int64 {
+	if g.ChunkSize > 0 {
+		return g.ChunkSize
+	}
+	return defaultAzureChunkSize
+}
+
+func (g *AzureBlobGetter) parallelism() int {
+	if g.Parallelism > 0 {
+		return g.Parallelism
+	}
+	return defaultAzureParallelism
+}
+
+// getBlobClient resolves credentials for the storage account referenced by
+// u (see resolveAzureAuth) and returns a client scoped to it.
+func (g *AzureBlobGetter) getBlobClient(u *url.URL) (*azblob.Client, error) {
+	auth, err := resolveAzureAuth(u, g.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case auth.sasQuery:
+		return azblob.NewClientWithNoCredential(auth.serviceURL, nil)
+	case auth.connectionStr != "":
+		return azblob.NewClientFromConnectionString(auth.connectionStr, nil)
+	case auth.sharedKey != nil:
+		cred, err := azblob.NewSharedKeyCredential(auth.sharedKey.accountName, auth.sharedKey.accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("getter: invalid AZURE_STORAGE_ACCOUNT_KEY: %w", err)
+		}
+		return azblob.NewClientWithSharedKeyCredential(auth.serviceURL, cred, nil)
+	default:
+		return azblob.NewClient(auth.serviceURL, auth.tokenCredential, nil)
+	}
 }
 
 func (g *AzureBlobGetter) ClientMode(u *url.URL) (ClientMode, error) {
-	blobURLParts := azblob.NewBlobURLParts(*u)
-	client, err := g.getBobClient(blobURLParts, "")
+	// A URL pinned to a snapshot or version always names a single blob;
+	// there's no listing to disambiguate against.
+	if azureObjectSelectorFromURL(u).pinned() {
+		return ClientModeFile, nil
+	}
+
+	client, err := g.getBlobClient(u)
 	if err != nil {
 		return 0, err
 	}
 
-	container := client.NewContainerURL(blobURLParts.ContainerName)
-
+	containerName, blobName := containerAndBlob(u)
 	ctx := context.Background()
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		listBlob, _ := container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: blobURLParts.BlobName})
 
-		marker = listBlob.NextMarker
+	pager := client.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{
+		Prefix: &blobName,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, mapAzureBlobError(fmt.Errorf("getter: listing blobs: %w", err), u)
+		}
 
-		for _, blobInfo := range listBlob.Segment.BlobItems {
-			if blobInfo.Name == blobURLParts.BlobName {
+		for _, blobItem := range page.Segment.BlobItems {
+			name := *blobItem.Name
+			if name == blobName {
 				return ClientModeFile, nil
 			}
 
-			if strings.HasPrefix(blobInfo.Name, blobURLParts.BlobName+"/") {
+			if strings.HasPrefix(name, blobName+"/") {
 				return ClientModeDir, nil
 			}
 		}
@@ -51,9 +208,6 @@ func (g *AzureBlobGetter) ClientMode(u *url.URL) (ClientMode, error) {
 }
 
 func (g *AzureBlobGetter) Get(dst string, u *url.URL) error {
-	//Parse URL
-	blobURLParts := azblob.NewBlobURLParts(*u)
-
 	// Remove destination if it already exists
 	_, err := os.Stat(dst)
 	if err != nil && !os.IsNotExist(err) {
@@ -72,72 +226,114 @@ func (g *AzureBlobGetter) Get(dst string, u *url.URL) error {
 		return err
 	}
 
-	client, err := g.getBobClient(blobURLParts, "")
+	client, err := g.getBlobClient(u)
 	if err != nil {
 		return err
 	}
 
-	containerURL := client.NewContainerURL(blobURLParts.ContainerName)
-
+	containerName, blobName := containerAndBlob(u)
+	sel := azureObjectSelectorFromURL(u)
 	ctx := context.Background()
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		// Get a result segment starting with the blob indicated by the current Marker.
-		listBlob, _ := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: blobURLParts.BlobName})
 
-		// ListBlobs returns the start of the next segment; you MUST use this to get
-		// the next segment (after processing the current result segment).
-		marker = listBlob.NextMarker
+	listOpts := &azblob.ListBlobsFlatOptions{Prefix: &blobName}
+	if sel.pinned() {
+		// Only ask for snapshots/versions when the URL actually pins one;
+		// otherwise every blob's snapshots and prior versions come back
+		// alongside its current version, and we'd download duplicates of
+		// the same blob to the same destination path.
+		listOpts.Include = azblob.ListBlobsInclude{Snapshots: true, Versions: true}
+	}
 
-		// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
-		for _, blobInfo := range listBlob.Segment.BlobItems {
-			objPath := blobInfo.Name
+	var blobPaths []string
+	pager := client.NewListBlobsFlatPager(containerName, listOpts)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return mapAzureBlobError(fmt.Errorf("getter: listing blobs: %w", err), u)
+		}
+
+		for _, blobItem := range page.Segment.BlobItems {
+			objPath := *blobItem.Name
 
 			// If the key ends with a backslash assume it is a directory and ignore
 			if strings.HasSuffix(objPath, "/") {
 				continue
 			}
 
-			// Get the object destination path
-			objDst, err := filepath.Rel(blobURLParts.BlobName, objPath)
-			if err != nil {
-				return err
-			}
+			blobPaths = append(blobPaths, objPath)
+		}
+	}
 
-			objDst = filepath.Join(dst, objDst)
+	// Download the blobs that make up the directory with a bounded pool of
+	// workers so a folder of many small files doesn't download serially.
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, g.parallelism())
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for _, objPath := range blobPaths {
+		objDst, err := filepath.Rel(blobName, objPath)
+		if err != nil {
+			return err
+		}
+		objDst = filepath.Join(dst, objDst)
 
-			if err := g.getObject(client, objDst, blobURLParts.ContainerName, objPath); err != nil {
-				return err
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(objPath, objDst string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := g.getObject(client, objDst, containerName, objPath, sel); err != nil {
+				errOnce.Do(func() { firstErr = mapAzureBlobError(err, u) })
 			}
-		}
+		}(objPath, objDst)
 	}
 
-	return nil
+	wg.Wait()
+	return firstErr
 }
 
 func (g *AzureBlobGetter) GetFile(dst string, u *url.URL) error {
-	blobURLParts := azblob.NewBlobURLParts(*u)
-	client, err := g.getBobClient(blobURLParts, "")
+	client, err := g.getBlobClient(u)
 	if err != nil {
 		return err
 	}
 
-	return g.getObject(client, dst, blobURLParts.ContainerName, blobURLParts.BlobName)
+	containerName, blobName := containerAndBlob(u)
+	if err := g.getObject(client, dst, containerName, blobName, azureObjectSelectorFromURL(u)); err != nil {
+		return mapAzureBlobError(err, u)
+	}
+	return nil
 }
 
-func (g *AzureBlobGetter) getObject(serviceURL azblob.ServiceURL, dst, container, blobName string) error {
+// getObject downloads a single blob to dst using concurrent ranged GETs of
+// g.chunkSize() bytes each, writing every chunk to its offset in the
+// destination file as it arrives. This avoids buffering the whole blob in
+// memory, which otherwise OOMs on large modules and artifacts.
+func (g *AzureBlobGetter) getObject(client *azblob.Client, dst, containerName, blobName string, sel azureObjectSelector) error {
 	ctx := context.Background()
-	containerURL := serviceURL.NewContainerURL(container)
-	blobURL := containerURL.NewBlockBlobURL(blobName)
 
-	get, err := blobURL.Download(ctx, 0, 0, azblob.BlobAccessConditions{}, false)
+	blobClient, err := scopedBlobClient(client, containerName, blobName, sel)
 	if err != nil {
 		return err
 	}
 
-	downloadedData := &bytes.Buffer{}
-	reader := get.Body(azblob.RetryReaderOptions{})
-	downloadedData.ReadFrom(reader)
-	reader.Close()
+	props, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if sel.etag != "" && props.ETag != nil && string(*props.ETag) != sel.etag {
+		return fmt.Errorf("%w: have %s, want %s", ErrETagMismatch, *props.ETag, sel.etag)
+	}
+
+	var size int64
+	if props.ContentLength != nil {
+		size = *props.ContentLength
+	}
 
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
@@ -149,33 +345,169 @@ func (g *AzureBlobGetter) getObject(serviceURL azblob.ServiceURL, dst, container
 	}
 	defer f.Close()
 
-	_, err = io.Copy(f, downloadedData)
-	return err
+	if size == 0 {
+		return nil
+	}
+
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+
+	type byteRange struct {
+		offset, count int64
+	}
+
+	chunkSize := g.chunkSize()
+	var ranges []byteRange
+	for offset := int64(0); offset < size; offset += chunkSize {
+		count := chunkSize
+		if offset+count > size {
+			count = size - offset
+		}
+		ranges = append(ranges, byteRange{offset, count})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, g.parallelism())
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for _, r := range ranges {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r byteRange) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := g.downloadChunkWithRetry(ctx, blobClient, blobName, f, r.offset, r.count, sel); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		// Close & remove the file in case of partial write.
+		_ = f.Close()
+		_ = os.Remove(dst)
+		return firstErr
+	}
+
+	if algo, expected, ok := azureBlobChecksum(props, sel); ok {
+		if err := verifyFileChecksum(dst, algo, expected); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scopedBlobClient returns a client for containerName/blobName, narrowed to
+// the snapshot or version sel pins the download to, if any. The real
+// azblob SDK carries that pinning on the blob client's URL rather than as a
+// per-call option, so every properties fetch and ranged GET issued for a
+// pinned blob must go through the client this returns.
+func scopedBlobClient(client *azblob.Client, containerName, blobName string, sel azureObjectSelector) (*blob.Client, error) {
+	blobClient := client.ServiceClient().NewContainerClient(containerName).NewBlobClient(blobName)
+	switch {
+	case sel.snapshot != "":
+		return blobClient.WithSnapshot(sel.snapshot)
+	case sel.versionID != "":
+		return blobClient.WithVersionID(sel.versionID)
+	default:
+		return blobClient, nil
+	}
 }
 
-func (g *AzureBlobGetter) getBobClient(blobUrlParts azblob.BlobURLParts, accountKey string) (azblob.ServiceURL, error) {
-	accountName := strings.SplitN(blobUrlParts.Host, ".", 3)[0]
+// azureBlobChecksum picks the checksum to verify a downloaded blob
+// against: a "checksum=" URL parameter if the caller supplied one, else
+// falling back to the Content-MD5 Azure itself reported on GetProperties.
+// GetProperties doesn't surface a CRC64 (that's only returned per-range on
+// download), so MD5 is the only backend-reported fallback available here.
+func azureBlobChecksum(props blob.GetPropertiesResponse, sel azureObjectSelector) (algo, expected string, ok bool) {
+	if sel.hasChecksum {
+		return sel.checksumAlgo, sel.checksumExpected, true
+	}
+	if len(props.ContentMD5) > 0 {
+		return "md5", hex.EncodeToString(props.ContentMD5), true
+	}
+	return "", "", false
+}
 
-	var credential azblob.Credential
-	var err error
+// downloadChunkWithRetry retries a single chunk independently of the rest of
+// the blob, so a transient failure partway through a large download doesn't
+// force restarting the whole transfer.
+func (g *AzureBlobGetter) downloadChunkWithRetry(ctx context.Context, blobClient *blob.Client, blobName string, f *os.File, offset, count int64, sel azureObjectSelector) error {
+	var lastErr error
+	for attempt := 0; attempt < azureChunkMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+		}
 
-	if accountKey != "" {
-		credential, err = azblob.NewSharedKeyCredential(accountName, accountKey)
-	} else {
-		credential = azblob.NewAnonymousCredential()
+		if err := g.downloadChunk(ctx, blobClient, blobName, f, offset, count, sel); err != nil {
+			if !isAzureChunkRetryable(err) {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		return nil
 	}
+	return fmt.Errorf("getter: downloading range [%d,%d) of %s after %d attempts: %w",
+		offset, offset+count, blobName, azureChunkMaxRetries, lastErr)
+}
 
-	if err != nil {
-		return azblob.ServiceURL{}, err
+// downloadChunk issues a single ranged GET and, when Azure returns the
+// range's Content-MD5, verifies it before writing the bytes to disk.
+func (g *AzureBlobGetter) downloadChunk(ctx context.Context, blobClient *blob.Client, blobName string, f *os.File, offset, count int64, sel azureObjectSelector) error {
+	rangeGetContentMD5 := true
+	opts := &blob.DownloadStreamOptions{
+		Range:              blob.HTTPRange{Offset: offset, Count: count},
+		RangeGetContentMD5: &rangeGetContentMD5,
+	}
+	if sel.etag != "" {
+		etag := azcore.ETag(sel.etag)
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag},
+		}
 	}
 
-	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	resp, err := blobClient.DownloadStream(ctx, opts)
+	if err != nil {
+		if sel.etag != "" && isAzurePreconditionFailed(err) {
+			return fmt.Errorf("%w: %s", ErrETagMismatch, sel.etag)
+		}
+		return err
+	}
+	defer resp.Body.Close()
 
-	u := blobUrlParts.URL()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
 
-	fqdn, _ := url.Parse(fmt.Sprintf("https://%s?%s", u.Host, u.RawQuery))
+	if resp.ContentMD5 != nil {
+		sum := md5.Sum(data)
+		if !bytes.Equal(sum[:], resp.ContentMD5) {
+			return fmt.Errorf("getter: MD5 mismatch downloading range [%d,%d) of %s", offset, offset+count, blobName)
+		}
+	}
 
-	serviceURL := azblob.NewServiceURL(*fqdn, p)
+	_, err = f.WriteAt(data, offset)
+	return err
+}
 
-	return serviceURL, nil
+// mapAzureBlobError maps Azure's "not found" responses (a missing blob or
+// container) onto ErrNotFound, so callers can use errors.Is regardless of
+// which Getter backend they're using. Any other error is returned as-is.
+func mapAzureBlobError(err error, u *url.URL) error {
+	if err == nil {
+		return nil
+	}
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return &NotFoundError{URL: u.String(), Err: err}
+	}
+	return err
 }
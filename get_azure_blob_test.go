@@ -1,12 +1,36 @@
 package getter
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
+// clearAzureEnv unsets every environment variable consulted by
+// AzureBlobGetter's credential resolution chain so tests can exercise one
+// branch at a time.
+func clearAzureEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"AZURE_STORAGE_CONNECTION_STRING",
+		"AZURE_STORAGE_ACCOUNT_KEY",
+		"AZURE_STORAGE_SAS_TOKEN",
+		"AZURE_CLIENT_ID",
+		"AZURE_TENANT_ID",
+		"AZURE_CLIENT_SECRET",
+	} {
+		old, had := os.LookupEnv(key)
+		os.Unsetenv(key)
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(key, old)
+			}
+		})
+	}
+}
+
 // The following storage account must consist of a container named `go-getter` with access type
 // blob and contain the following blobs:
 //   folder/main.tf
@@ -97,6 +121,9 @@ func TestAzureBlobGetter_GetFile_notfound(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected error, got none")
 	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got: %s", err)
+	}
 }
 
 func TestAzureBlobGetter_ClientMode_dir(t *testing.T) {
@@ -146,6 +173,137 @@ func TestAzureBlobGetter_ClientMode_notfound(t *testing.T) {
 	}
 }
 
+func TestAzureBlobGetter_getBlobClient_sasFromURL(t *testing.T) {
+	clearAzureEnv(t)
+	g := new(AzureBlobGetter)
+
+	client, err := g.getBlobClient(
+		testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?%s", azureBlobURL, sasToken)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client == nil {
+		t.Fatal("expected a client")
+	}
+}
+
+func TestAzureBlobGetter_getBlobClient_connectionString(t *testing.T) {
+	clearAzureEnv(t)
+	os.Setenv("AZURE_STORAGE_CONNECTION_STRING",
+		"DefaultEndpointsProtocol=https;AccountName=gaodnn4xiwdhaf45grxl4e7n;"+
+			"AccountKey=ZmFrZWtleQ==;EndpointSuffix=core.windows.net")
+	defer os.Unsetenv("AZURE_STORAGE_CONNECTION_STRING")
+
+	g := new(AzureBlobGetter)
+	client, err := g.getBlobClient(testURL(fmt.Sprintf("%s/go-getter/folder/main.tf", azureBlobURL)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client == nil {
+		t.Fatal("expected a client")
+	}
+}
+
+func TestAzureBlobGetter_getBlobClient_accountKey(t *testing.T) {
+	clearAzureEnv(t)
+	os.Setenv("AZURE_STORAGE_ACCOUNT_KEY", "ZmFrZWtleQ==")
+	defer os.Unsetenv("AZURE_STORAGE_ACCOUNT_KEY")
+
+	g := new(AzureBlobGetter)
+	client, err := g.getBlobClient(testURL(fmt.Sprintf("%s/go-getter/folder/main.tf", azureBlobURL)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client == nil {
+		t.Fatal("expected a client")
+	}
+}
+
+func TestAzureBlobGetter_getBlobClient_authModeForcedMissing(t *testing.T) {
+	clearAzureEnv(t)
+	g := new(AzureBlobGetter)
+
+	// Forcing a mode whose prerequisites aren't met should fail rather than
+	// silently falling through to the next entry in the chain.
+	_, err := g.getBlobClient(
+		testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?auth=key", azureBlobURL)))
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+func TestAzureBlobGetter_getBlobClient_authModeForcedMissing_msi(t *testing.T) {
+	clearAzureEnv(t)
+	g := new(AzureBlobGetter)
+
+	// This sandbox has no instance metadata service reachable, so forcing
+	// auth=msi should fail the availability probe rather than reporting
+	// success and deferring the failure to the first blob request.
+	_, err := g.getBlobClient(
+		testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?auth=msi", azureBlobURL)))
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+func TestAzureBlobGetter_chunkSizeAndParallelism_defaults(t *testing.T) {
+	g := new(AzureBlobGetter)
+
+	if got := g.chunkSize(); got != defaultAzureChunkSize {
+		t.Fatalf("expected default chunk size %d, got %d", defaultAzureChunkSize, got)
+	}
+	if got := g.parallelism(); got != defaultAzureParallelism {
+		t.Fatalf("expected default parallelism %d, got %d", defaultAzureParallelism, got)
+	}
+
+	g.ChunkSize = 1024
+	g.Parallelism = 2
+	if got := g.chunkSize(); got != 1024 {
+		t.Fatalf("expected chunk size 1024, got %d", got)
+	}
+	if got := g.parallelism(); got != 2 {
+		t.Fatalf("expected parallelism 2, got %d", got)
+	}
+}
+
+func TestAzureBlobGetter_ClientMode_pinnedSnapshot(t *testing.T) {
+	g := new(AzureBlobGetter)
+
+	// A URL pinned to a snapshot or version always names a single blob, so
+	// this must not require a network call to resolve.
+	mode, err := g.ClientMode(
+		testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?snapshot=2020-01-01T00:00:00.0000000Z", azureBlobURL)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mode != ClientModeFile {
+		t.Fatal("expect ClientModeFile")
+	}
+
+	mode, err = g.ClientMode(
+		testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?versionid=2020-01-01T00:00:00.0000000Z", azureBlobURL)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mode != ClientModeFile {
+		t.Fatal("expect ClientModeFile")
+	}
+}
+
+func TestAzureBlobGetter_GetFile_etagMismatch(t *testing.T) {
+	g := new(AzureBlobGetter)
+	dst := tempTestFile(t)
+
+	err := g.GetFile(
+		dst, testURL(fmt.Sprintf("%s/go-getter/folder/main.tf?%s&etag=\"not-the-real-etag\"", azureBlobURL, sasToken)))
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !errors.Is(err, ErrETagMismatch) {
+		t.Fatalf("expected ErrETagMismatch, got: %s", err)
+	}
+}
+
 func TestAzureBlobGetter_ClientMode_collision(t *testing.T) {
 	g := new(AzureBlobGetter)
 
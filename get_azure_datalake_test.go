@@ -0,0 +1,31 @@
+package getter
+
+import "testing"
+
+func TestAzureDataLake_impl(t *testing.T) {
+	var _ Getter = new(AzureDataLakeGetter)
+}
+
+func TestParseDataLakePermissions(t *testing.T) {
+	cases := []struct {
+		perm    string
+		wantOK  bool
+		wantOct uint32
+	}{
+		{"rwxr-x---", true, 0750},
+		{"rwxrwxrwx", true, 0777},
+		{"---------", true, 0000},
+		{"not-a-perm-string", false, 0},
+		{"rwxrwx", false, 0},
+	}
+
+	for _, c := range cases {
+		mode, ok := parseDataLakePermissions(c.perm)
+		if ok != c.wantOK {
+			t.Fatalf("parseDataLakePermissions(%q): ok = %v, want %v", c.perm, ok, c.wantOK)
+		}
+		if ok && uint32(mode) != c.wantOct {
+			t.Fatalf("parseDataLakePermissions(%q): mode = %o, want %o", c.perm, mode, c.wantOct)
+		}
+	}
+}